@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+func TestComponentCatalogDirectives(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		parameter Limit {"name": "limit", "in": "query"}
+		requestBody NewPet {"content": {}}
+		response NotFound {"description": "not found"}
+		header RateLimit {"description": "requests left"}
+		example PetExample {"value": {"name": "Rex"}}
+		link GetPetByName {"operationId": "getPet"}
+		callback OnEvent {}
+	`)
+	cases := []struct {
+		name string
+		got  map[string]interface{}
+	}{
+		{"parameter", spec.Components.Parameters},
+		{"requestBody", spec.Components.RequestBodies},
+		{"response", spec.Components.Responses},
+		{"header", spec.Components.Headers},
+		{"example", spec.Components.Examples},
+		{"link", spec.Components.Links},
+		{"callback", spec.Components.Callbacks},
+	}
+	for _, c := range cases {
+		if len(c.got) != 1 {
+			t.Errorf("%s: expected 1 component, got %v", c.name, c.got)
+		}
+	}
+}
+
+func TestComponentRedefinitionIsAnError(t *testing.T) {
+	spec := &openAPISpec{}
+	err := spec.parse("spec.rjson", []byte(`
+		parameter Limit {"name": "limit", "in": "query"}
+		parameter Limit {"name": "limit", "in": "header"}
+	`))
+	if err == nil {
+		t.Fatal("expected an error for a redefined parameter")
+	}
+}
+
+func TestRootLevelArrayDirectives(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		server prod {"url": "https://api.example.com"}
+		server staging {"url": "https://staging.example.com"}
+		tag pets {"name": "pets"}
+		externalDocs {"url": "https://example.com/docs"}
+	`)
+	if len(spec.Servers) != 2 {
+		t.Fatalf("expected 2 servers, got %v", spec.Servers)
+	}
+	if len(spec.Tags) != 1 {
+		t.Fatalf("expected 1 tag, got %v", spec.Tags)
+	}
+	if spec.ExternalDocs == nil {
+		t.Fatal("externalDocs not set")
+	}
+}
+
+func TestServerRedefinitionIsAnError(t *testing.T) {
+	spec := &openAPISpec{}
+	err := spec.parse("spec.rjson", []byte(`
+		server prod {"url": "https://a.example.com"}
+		server prod {"url": "https://b.example.com"}
+	`))
+	if err == nil {
+		t.Fatal("expected an error for a redefined server")
+	}
+}
+
+func TestOpenAPIDirectiveOverridesVersion(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		openapi 3.0.3 {}
+	`)
+	if spec.Version != "3.0.3" {
+		t.Fatalf("Version = %q, want 3.0.3", spec.Version)
+	}
+	if spec.mode != mode30 {
+		t.Fatalf("mode = %v, want mode30", spec.mode)
+	}
+}
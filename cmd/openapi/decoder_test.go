@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadObjectAllowsClosingBraceOffColumnZero(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `schema Pet {"type": "object",
+		"properties": {"name": {"type": "string"}}}`)
+	if _, ok := spec.Components.Schemas["Pet"]; !ok {
+		t.Fatalf("schema not parsed: %v", spec.Components.Schemas)
+	}
+}
+
+func TestReadObjectAllowsBraceInStringLiteral(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `schema Pet {"type": "string", "description": "a pet, e.g. {\"name\":\"Rex\"}"}`)
+	got := spec.Components.Schemas["Pet"].(map[string]interface{})
+	want := `a pet, e.g. {"name":"Rex"}`
+	if got["description"] != want {
+		t.Fatalf("description = %q, want %q", got["description"], want)
+	}
+}
+
+func TestReadObjectDoesNotSwallowTrailingContent(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		schema Pet {"type": "string"}
+		schema Owner {"type": "string"}
+		info {"title": "pets", "version": "1.0"}
+	`)
+	if len(spec.Components.Schemas) != 2 {
+		t.Fatalf("expected both schemas after the first object, got %v", spec.Components.Schemas)
+	}
+	if spec.Info == nil {
+		t.Fatal("directive after two objects was not parsed")
+	}
+}
+
+func TestReadObjectReportsSyntaxErrorLocation(t *testing.T) {
+	spec := &openAPISpec{}
+	err := spec.parse("spec.rjson", []byte("schema Pet {\"type\": }"))
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	if got := err.Error(); !strings.HasPrefix(got, "spec.rjson:1") {
+		t.Fatalf("expected a located error message, got %q", got)
+	}
+}
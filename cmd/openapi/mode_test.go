@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchema30ModeLeavesNullableAlone(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		schema Pet {"type": "string", "nullable": true}
+	`)
+	got := spec.Components.Schemas["Pet"].(map[string]interface{})
+	if got["type"] != "string" {
+		t.Fatalf("type rewritten in 3.0 mode: %v", got["type"])
+	}
+	if nullable, ok := got["nullable"].(bool); !ok || !nullable {
+		t.Fatalf("nullable dropped in 3.0 mode: %v", got)
+	}
+}
+
+func TestSchema30ModeRejects31OnlyKeywords(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		schema Pet {"type": "object", "unevaluatedProperties": false}
+	`)
+	err := spec.Validate()
+	if err == nil || !strings.Contains(err.Error(), "unevaluatedProperties requires OpenAPI 3.1 mode") {
+		t.Fatalf("expected an unevaluatedProperties error, got %v", err)
+	}
+}
+
+func TestSchema31ModeAllows31OnlyKeywords(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		openapi 3.1.0 {}
+		schema Pet {"type": ["string", "null"], "unevaluatedProperties": false, "const": "fixed"}
+	`)
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestWebhookBeforeOpenAPIDirectiveIsAccepted(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		webhook newPet post {"responses": {}}
+		openapi 3.1.0 {}
+	`)
+	if _, ok := spec.Webhooks["newPet"]["post"]; !ok {
+		t.Fatalf("webhook not registered: %v", spec.Webhooks)
+	}
+}
+
+func TestWebhookRejectedWithout31Mode(t *testing.T) {
+	spec := &openAPISpec{}
+	err := spec.parse("spec.rjson", []byte(`
+		webhook newPet post {"responses": {}}
+	`))
+	if err == nil || !strings.Contains(err.Error(), "webhook requires OpenAPI 3.1 mode") {
+		t.Fatalf("expected a webhook mode error, got %v", err)
+	}
+}
+
+func TestValidateResolvesWebhookRef(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		openapi 3.1.0 {}
+		webhook newPet post {"responses": {"200": {"description": "ok"}}}
+		schema Notification {"type": "object", "properties": {"onNewPet": {"$ref": "#/webhooks/newPet/post/responses"}}}
+	`)
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestValidateCatches31OnlyKeywordInInlineOperationSchema(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		path /pets get {"responses": {"200": {"content": {"application/json": {"schema": {"unevaluatedProperties": false}}}}}}
+	`)
+	err := spec.Validate()
+	if err == nil || !strings.Contains(err.Error(), "unevaluatedProperties requires OpenAPI 3.1 mode") {
+		t.Fatalf("expected an unevaluatedProperties error for an inline operation schema, got %v", err)
+	}
+}
+
+func TestValidateCatches31OnlyKeywordInRequestBodyComponent(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		requestBody NewPet {"content": {"application/json": {"schema": {"prefixItems": []}}}}
+	`)
+	err := spec.Validate()
+	if err == nil || !strings.Contains(err.Error(), "prefixItems requires OpenAPI 3.1 mode") {
+		t.Fatalf("expected a prefixItems error for a requestBody's inline schema, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+func TestOperationTagNoTrailingObject(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		path /pets get {"responses": {}}
+		operation-tag /pets get funny
+		operation-tag /pets get animals
+		schema Unrelated {"type": "string"}
+	`)
+	op := spec.Paths["/pets"]["get"].(map[string]interface{})
+	tags := op["tags"].([]interface{})
+	if len(tags) != 2 || tags[0] != "funny" || tags[1] != "animals" {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+	if _, ok := spec.Components.Schemas["Unrelated"]; !ok {
+		t.Fatal("directive after operation-tag was not parsed")
+	}
+}
+
+func TestOperationSecurityMergesAcrossDirectives(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		security apiKey {"type": "apiKey", "in": "header", "name": "X-Api-Key"}
+		security oauth {"type": "oauth2"}
+		path /pets get {"responses": {}}
+		operation-security /pets get apiKey {}
+		operation-security /pets get oauth {"scopes": ["read"]}
+	`)
+	op := spec.Paths["/pets"]["get"].(map[string]interface{})
+	security := op["security"].([]interface{})
+	if len(security) != 2 {
+		t.Fatalf("expected security requirements to merge, got %v", security)
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestOperationParamMergesAcrossDirectives(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		path /pets get {"responses": {}}
+		operation-param /pets get {"name": "limit", "in": "query"}
+		operation-param /pets get {"name": "offset", "in": "query"}
+	`)
+	op := spec.Paths["/pets"]["get"].(map[string]interface{})
+	params := op["parameters"].([]interface{})
+	if len(params) != 2 {
+		t.Fatalf("expected parameters to merge, got %v", params)
+	}
+}
+
+func TestOperationDirectiveOnUndeclaredOperation(t *testing.T) {
+	spec := &openAPISpec{}
+	err := spec.parse("spec.rjson", []byte(`
+		operation-tag /pets get funny
+	`))
+	if err == nil {
+		t.Fatal("expected an error for a directive on an undeclared operation")
+	}
+}
+
+func TestIncludeNoTrailingObject(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		include other.rjson
+		schema Pet {"type": "string"}
+	`)
+	if len(spec.includes) != 1 || spec.includes[0] != "other.rjson" {
+		t.Fatalf("unexpected includes: %v", spec.includes)
+	}
+	if _, ok := spec.Components.Schemas["Pet"]; !ok {
+		t.Fatal("directive after include was not parsed")
+	}
+}
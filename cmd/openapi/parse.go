@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -15,13 +18,50 @@ import (
 type openAPIComponents struct {
 	Schemas         map[string]interface{} `yaml:"schemas,omitempty"`
 	SecuritySchemes map[string]interface{} `yaml:"securitySchemes,omitempty"`
+	Parameters      map[string]interface{} `yaml:"parameters,omitempty"`
+	RequestBodies   map[string]interface{} `yaml:"requestBodies,omitempty"`
+	Responses       map[string]interface{} `yaml:"responses,omitempty"`
+	Headers         map[string]interface{} `yaml:"headers,omitempty"`
+	Examples        map[string]interface{} `yaml:"examples,omitempty"`
+	Links           map[string]interface{} `yaml:"links,omitempty"`
+	Callbacks       map[string]interface{} `yaml:"callbacks,omitempty"`
 }
 
 type openAPISpec struct {
-	Version    string                            `yaml:"openapi,omitempty"`
-	Info       interface{}                       `yaml:"info,omitempty"`
-	Paths      map[string]map[string]interface{} `yaml:"paths,omitempty"`
-	Components openAPIComponents                 `yaml:"components"`
+	Version      string                            `yaml:"openapi,omitempty"`
+	Info         interface{}                       `yaml:"info,omitempty"`
+	Servers      []interface{}                     `yaml:"servers,omitempty"`
+	Tags         []interface{}                     `yaml:"tags,omitempty"`
+	ExternalDocs interface{}                       `yaml:"externalDocs,omitempty"`
+	Paths        map[string]map[string]interface{} `yaml:"paths,omitempty"`
+	Webhooks     map[string]map[string]interface{} `yaml:"webhooks,omitempty"`
+	Components   openAPIComponents                 `yaml:"components"`
+
+	// mode selects which version of the schema compilation and
+	// validation rules apply; see specMode. It's set by the openapi
+	// directive and defaults to mode30.
+	mode specMode
+
+	// seenNames guards against redefinition of directives whose
+	// identity lives in an array rather than a name-keyed map, where
+	// there's no map entry to check for a collision.
+	seenNames map[kind]map[string]bool
+
+	// includes holds the relative paths named by include directives,
+	// for Bundle to load and inline external $refs from.
+	includes []string
+
+	// srcFilename and srcBuf, together with offsets, let Validate
+	// report locations after parsing has finished and the reader is
+	// gone. offsets maps a locator key (see locatorKey) for each
+	// component, path, webhook and info directive to the byte offset
+	// it started at (other directives get no entry); nested
+	// values within a directive's object share that directive's
+	// location, since rjson discards positions once it's decoded
+	// into interface{}.
+	srcFilename string
+	srcBuf      []byte
+	offsets     map[string]int
 }
 
 func (spec *openAPISpec) parse(filename string, data []byte) error {
@@ -30,11 +70,13 @@ func (spec *openAPISpec) parse(filename string, data []byte) error {
 		buf:      data,
 		r:        bytes.NewReader(data),
 	}
+	spec.srcFilename = filename
+	spec.srcBuf = data
 	for {
 		tok, err := r.readToken()
 		if err != nil {
 			if errgo.Cause(err) == io.EOF {
-				return nil
+				return spec.finish()
 			}
 			return errgo.Mask(err)
 		}
@@ -48,75 +90,580 @@ func (spec *openAPISpec) parse(filename string, data []byte) error {
 		lineStart := r.tokenStart
 		var args []string
 		var obj interface{}
-		for {
-			tok, err := r.readToken()
-			if err != nil {
-				if errgo.Cause(err) == io.EOF {
-					return nil
+		if noObjectKinds[k] {
+			for len(args) < argCount[k] {
+				tok, err := r.readToken()
+				if err != nil {
+					return errgo.Mask(err)
+				}
+				if tok != tokenIdent {
+					return errgo.Newf("%s: unexpected token type %v", r.offsetToPos(r.tokenStart), tok)
 				}
-				return errgo.Mask(err)
+				args = append(args, r.token)
 			}
-			if tok == tokenObject {
-				obj = r.obj
-				break
+		} else {
+			for {
+				tok, err := r.readToken()
+				if err != nil {
+					if errgo.Cause(err) == io.EOF {
+						return spec.finish()
+					}
+					return errgo.Mask(err)
+				}
+				if tok == tokenObject {
+					obj = r.obj
+					break
+				}
+				args = append(args, r.token)
 			}
-			args = append(args, r.token)
 		}
-		if err := spec.add(k, args, obj); err != nil {
+		if err := spec.add(k, args, obj, lineStart); err != nil {
 			return errgo.Notef(err, "%s", r.offsetToPos(lineStart))
 		}
 	}
 }
 
-func (spec *openAPISpec) add(k kind, args []string, obj interface{}) error {
+// finish runs once the whole file has been parsed and spec.mode has
+// its final value, so mode-dependent handling doesn't depend on the
+// openapi directive appearing before whatever directive it governs.
+// webhook directives are one such case: a webhook declared before the
+// file's `openapi 3.1.0` directive must still be accepted, so the
+// mode check happens here instead of at parse time of the directive
+// itself.
+func (spec *openAPISpec) finish() error {
+	if spec.mode != mode31 {
+		for name, methods := range spec.Webhooks {
+			for method := range methods {
+				locator := locatorKey(kindWebhook, []string{name, method})
+				return errgo.Newf("%s: webhook requires OpenAPI 3.1 mode (add an `openapi 3.1.0` directive)", spec.pos(locator))
+			}
+		}
+	}
+	return nil
+}
+
+func (spec *openAPISpec) add(k kind, args []string, obj interface{}, offset int) error {
 	if len(args) != argCount[k] {
 		return errgo.Newf("unexpected arg count for %v; got %d want %d", k, len(args), argCount[k])
 	}
 	switch k {
-	case kindSchema:
+	case kindSchema, kindSecurity, kindParameter, kindRequestBody, kindResponse, kindHeader, kindExample, kindLink, kindCallback:
 		name := args[0]
-		if spec.Components.Schemas[name] != nil {
-			return errgo.Newf("schema %s redefined", name)
+		m := spec.componentMap(k)
+		if (*m)[name] != nil {
+			return errgo.Newf("%s %s redefined", componentNoun[k], name)
 		}
-		if spec.Components.Schemas == nil {
-			spec.Components.Schemas = make(map[string]interface{})
+		if *m == nil {
+			*m = make(map[string]interface{})
 		}
-		spec.Components.Schemas[name] = obj
-	case kindSecurity:
-		name := args[0]
-		if spec.Components.SecuritySchemes[name] != nil {
-			return errgo.Newf("security scheme %s redefined", name)
+		(*m)[name] = obj
+		spec.setOffset(locatorKey(k, args), offset)
+	case kindInclude:
+		spec.includes = append(spec.includes, args[0])
+	case kindServer:
+		if err := spec.checkRedefined(k, "server", args[0]); err != nil {
+			return err
 		}
-		if spec.Components.SecuritySchemes == nil {
-			spec.Components.SecuritySchemes = make(map[string]interface{})
+		spec.Servers = append(spec.Servers, obj)
+	case kindTag:
+		if err := spec.checkRedefined(k, "tag", args[0]); err != nil {
+			return err
+		}
+		spec.Tags = append(spec.Tags, obj)
+	case kindExternalDocs:
+		if spec.ExternalDocs != nil {
+			return errgo.Newf("externalDocs redefined")
+		}
+		spec.ExternalDocs = obj
+	case kindOpenAPI:
+		spec.Version = args[0]
+		spec.mode = mode30
+		if strings.HasPrefix(spec.Version, "3.1") {
+			spec.mode = mode31
 		}
-		spec.Components.SecuritySchemes[name] = obj
 	case kindPath:
 		path, method := args[0], args[1]
-		if !allowedMethods[method] {
-			return errgo.Newf("unknown method %q for path %q", args[1], args[0])
+		if err := spec.addPathItem(&spec.Paths, path, method, obj); err != nil {
+			return err
+		}
+		spec.setOffset(locatorKey(k, args), offset)
+	case kindWebhook:
+		name, method := args[0], args[1]
+		if err := spec.addPathItem(&spec.Webhooks, name, method, obj); err != nil {
+			return err
 		}
-		if spec.Paths == nil {
-			spec.Paths = make(map[string]map[string]interface{})
+		spec.setOffset(locatorKey(k, args), offset)
+	case kindOperationSecurity:
+		path, method, scheme := args[0], args[1], args[2]
+		op, err := spec.operation(path, method)
+		if err != nil {
+			return err
 		}
-		if spec.Paths[path][method] != nil {
-			return errgo.Newf("redefinition of %s method for path %q", method, path)
+		opts, _ := obj.(map[string]interface{})
+		scopes, _ := opts["scopes"].([]interface{})
+		security, _ := op["security"].([]interface{})
+		op["security"] = append(security, map[string]interface{}{scheme: scopes})
+	case kindOperationParam:
+		path, method := args[0], args[1]
+		op, err := spec.operation(path, method)
+		if err != nil {
+			return err
 		}
-		if spec.Paths[path] == nil {
-			spec.Paths[path] = make(map[string]interface{})
+		params, _ := op["parameters"].([]interface{})
+		op["parameters"] = append(params, obj)
+	case kindOperationTag:
+		path, method, tag := args[0], args[1], args[2]
+		op, err := spec.operation(path, method)
+		if err != nil {
+			return err
 		}
-		spec.Paths[path][method] = obj
+		tags, _ := op["tags"].([]interface{})
+		op["tags"] = append(tags, tag)
 	case kindInfo:
 		if spec.Info != nil {
 			return errgo.Newf("info redefined")
 		}
 		spec.Info = obj
+		spec.setOffset(locatorKey(k, args), offset)
 	default:
 		return errgo.Newf("unknown kind %v", k)
 	}
 	return nil
 }
 
+// addPathItem registers obj as the handler for method on key (a URL
+// path for spec.Paths, a webhook name for spec.Webhooks) within dest,
+// guarding against an unknown method or a redefinition. path and
+// webhook directives share this, since a webhook is structurally a
+// path item keyed by name instead of by URL.
+func (spec *openAPISpec) addPathItem(dest *map[string]map[string]interface{}, key, method string, obj interface{}) error {
+	if !allowedMethods[method] {
+		return errgo.Newf("unknown method %q for path %q", method, key)
+	}
+	if *dest == nil {
+		*dest = make(map[string]map[string]interface{})
+	}
+	if (*dest)[key][method] != nil {
+		return errgo.Newf("redefinition of %s method for path %q", method, key)
+	}
+	if (*dest)[key] == nil {
+		(*dest)[key] = make(map[string]interface{})
+	}
+	(*dest)[key][method] = obj
+	return nil
+}
+
+// operation returns the already-registered operation object for
+// method on path, so that operation-* directives can mutate it in
+// place rather than requiring authors to hand-write security,
+// parameters and tags inside every path directive's rjson block.
+func (spec *openAPISpec) operation(path, method string) (map[string]interface{}, error) {
+	op, ok := spec.Paths[path][method].(map[string]interface{})
+	if !ok {
+		return nil, errgo.Newf("operation %s %s not declared", method, path)
+	}
+	return op, nil
+}
+
+// componentMap returns a pointer to the field of spec.Components that
+// holds components of kind k, or nil if k isn't a component kind.
+func (spec *openAPISpec) componentMap(k kind) *map[string]interface{} {
+	switch k {
+	case kindSchema:
+		return &spec.Components.Schemas
+	case kindSecurity:
+		return &spec.Components.SecuritySchemes
+	case kindParameter:
+		return &spec.Components.Parameters
+	case kindRequestBody:
+		return &spec.Components.RequestBodies
+	case kindResponse:
+		return &spec.Components.Responses
+	case kindHeader:
+		return &spec.Components.Headers
+	case kindExample:
+		return &spec.Components.Examples
+	case kindLink:
+		return &spec.Components.Links
+	case kindCallback:
+		return &spec.Components.Callbacks
+	}
+	return nil
+}
+
+// componentNoun gives the human-readable name used in redefinition
+// errors for each component kind.
+var componentNoun = map[kind]string{
+	kindSchema:      "schema",
+	kindSecurity:    "security scheme",
+	kindParameter:   "parameter",
+	kindRequestBody: "request body",
+	kindResponse:    "response",
+	kindHeader:      "header",
+	kindExample:     "example",
+	kindLink:        "link",
+	kindCallback:    "callback",
+}
+
+// checkRedefined records that name has been used for kind k, returning
+// an error if it was already used.
+func (spec *openAPISpec) checkRedefined(k kind, noun, name string) error {
+	if spec.seenNames[k][name] {
+		return errgo.Newf("%s %s redefined", noun, name)
+	}
+	if spec.seenNames == nil {
+		spec.seenNames = make(map[kind]map[string]bool)
+	}
+	if spec.seenNames[k] == nil {
+		spec.seenNames[k] = make(map[string]bool)
+	}
+	spec.seenNames[k][name] = true
+	return nil
+}
+
+// specMode selects which version of the schema compilation and
+// validation rules a spec follows, set by the openapi directive.
+type specMode int
+
+const (
+	mode30 specMode = iota
+	mode31
+)
+
+// mode31OnlyKeywords are JSON Schema 2020-12 keywords that OpenAPI
+// only allows once a document opts into 3.1 via the openapi
+// directive; in 3.0 mode they're a validation error.
+var mode31OnlyKeywords = []string{"$dynamicRef", "$dynamicAnchor", "unevaluatedProperties", "prefixItems", "const"}
+
+// componentSection maps the pointer segment used under
+// #/components/... (the component map's yaml field name) back to the
+// kind that owns it, for resolving $refs and for Bundle.
+var componentSection = map[string]kind{
+	"schemas":         kindSchema,
+	"securitySchemes": kindSecurity,
+	"parameters":      kindParameter,
+	"requestBodies":   kindRequestBody,
+	"responses":       kindResponse,
+	"headers":         kindHeader,
+	"examples":        kindExample,
+	"links":           kindLink,
+	"callbacks":       kindCallback,
+}
+
+// locatorKey builds the key used in spec.offsets for the top-level
+// directive identified by k and args.
+func locatorKey(k kind, args []string) string {
+	return fmt.Sprintf("%d:%s", k, strings.Join(args, "\x00"))
+}
+
+// setOffset records the source offset of a locatable directive.
+func (spec *openAPISpec) setOffset(key string, offset int) {
+	if spec.offsets == nil {
+		spec.offsets = make(map[string]int)
+	}
+	spec.offsets[key] = offset
+}
+
+// pos formats the location recorded under key, falling back to just
+// the filename if no offset was recorded (for specs assembled without
+// going through parse, or for a locator that was never a directive).
+func (spec *openAPISpec) pos(key string) string {
+	off, ok := spec.offsets[key]
+	if !ok {
+		return spec.srcFilename
+	}
+	return formatPos(spec.srcFilename, spec.srcBuf, off)
+}
+
+// Validate walks the spec looking for $refs that don't resolve to a
+// node in the same document, 3.1-only schema keywords used while in
+// 3.0 mode, per-operation security requirements that name an
+// undeclared security scheme, and operations using an unknown HTTP
+// method. It reports every problem it finds rather than stopping at
+// the first one.
+func (spec *openAPISpec) Validate() error {
+	var problems []string
+	for _, k := range componentSection {
+		for compName, v := range *spec.componentMap(k) {
+			locator := locatorKey(k, []string{compName})
+			spec.findBadRefs(v, locator, &problems)
+		}
+	}
+	spec.validateOperations(kindPath, spec.Paths, &problems)
+	spec.validateOperations(kindWebhook, spec.Webhooks, &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	return errgo.Newf("invalid spec:\n%s", strings.Join(problems, "\n"))
+}
+
+// validateOperations checks every operation under a path or webhook
+// map, reporting unknown methods, unresolved $refs and dangling
+// security schemes. k distinguishes the two only for locator keys.
+func (spec *openAPISpec) validateOperations(k kind, m map[string]map[string]interface{}, problems *[]string) {
+	for key, methods := range m {
+		for method, op := range methods {
+			locator := locatorKey(k, []string{key, method})
+			if !allowedMethods[method] {
+				*problems = append(*problems, fmt.Sprintf("%s: unknown method %q for path %q", spec.pos(locator), method, key))
+			}
+			spec.findBadRefs(op, locator, problems)
+			if opMap, ok := op.(map[string]interface{}); ok {
+				spec.checkOperationSecurity(opMap, locator, problems)
+			}
+		}
+	}
+}
+
+// findBadRefs recursively walks v (a value decoded from rjson, so
+// only ever made of map[string]interface{}, []interface{} and scalar
+// types) looking for {"$ref": "..."} nodes whose ref doesn't resolve,
+// and, while in 3.0 mode, for any 3.1-only schema keyword. It walks
+// every value regardless of what directive produced it, since a
+// schema can just as easily sit inline inside an operation's
+// requestBody or response as under the top-level schema catalog.
+// Every problem found is reported against locator, since finer
+// positions within a directive's object aren't tracked.
+func (spec *openAPISpec) findBadRefs(v interface{}, locator string, problems *[]string) {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := vv["$ref"].(string); ok {
+			if !spec.resolveRef(ref) {
+				*problems = append(*problems, fmt.Sprintf("%s: unresolved $ref %q", spec.pos(locator), ref))
+			}
+		}
+		if spec.mode == mode30 {
+			for _, kw := range mode31OnlyKeywords {
+				if _, ok := vv[kw]; ok {
+					*problems = append(*problems, fmt.Sprintf("%s: %s requires OpenAPI 3.1 mode", spec.pos(locator), kw))
+				}
+			}
+		}
+		for _, sub := range vv {
+			spec.findBadRefs(sub, locator, problems)
+		}
+	case []interface{}:
+		for _, sub := range vv {
+			spec.findBadRefs(sub, locator, problems)
+		}
+	}
+}
+
+// checkOperationSecurity reports any scheme named in op's security
+// requirements that isn't declared under components.securitySchemes.
+func (spec *openAPISpec) checkOperationSecurity(op map[string]interface{}, locator string, problems *[]string) {
+	security, _ := op["security"].([]interface{})
+	for _, reqi := range security {
+		req, ok := reqi.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for scheme := range req {
+			if spec.Components.SecuritySchemes[scheme] == nil {
+				*problems = append(*problems, fmt.Sprintf("%s: security scheme %q not declared", spec.pos(locator), scheme))
+			}
+		}
+	}
+}
+
+// resolveRef reports whether ref is a JSON Pointer into this document
+// (i.e. "#/...") that resolves to an actual node. External refs
+// (anything not starting with "#/") are left for Bundle to inline and
+// aren't considered resolved here.
+func (spec *openAPISpec) resolveRef(ref string) bool {
+	if !strings.HasPrefix(ref, "#/") {
+		return false
+	}
+	segs := pointerSegments(ref)
+	if len(segs) == 0 {
+		return false
+	}
+	switch segs[0] {
+	case "info":
+		_, ok := walkPointer(spec.Info, segs[1:])
+		return ok
+	case "paths":
+		if len(segs) < 3 {
+			return false
+		}
+		op, ok := spec.Paths[segs[1]][segs[2]]
+		if !ok {
+			return false
+		}
+		_, ok = walkPointer(op, segs[3:])
+		return ok
+	case "webhooks":
+		if len(segs) < 3 {
+			return false
+		}
+		op, ok := spec.Webhooks[segs[1]][segs[2]]
+		if !ok {
+			return false
+		}
+		_, ok = walkPointer(op, segs[3:])
+		return ok
+	case "components":
+		if len(segs) < 3 {
+			return false
+		}
+		k, ok := componentSection[segs[1]]
+		if !ok {
+			return false
+		}
+		v, ok := (*spec.componentMap(k))[segs[2]]
+		if !ok {
+			return false
+		}
+		_, ok = walkPointer(v, segs[3:])
+		return ok
+	}
+	return false
+}
+
+// pointerSegments splits the fragment of a JSON Pointer ("#/a/b/c")
+// into its unescaped segments ("a", "b", "c").
+func pointerSegments(ref string) []string {
+	segs := strings.Split(strings.TrimPrefix(ref, "#/"), "/")
+	for i, s := range segs {
+		s = strings.ReplaceAll(s, "~1", "/")
+		s = strings.ReplaceAll(s, "~0", "~")
+		segs[i] = s
+	}
+	return segs
+}
+
+// walkPointer follows segs into v, which is assumed to be built from
+// the same set of types rjson decodes objects into.
+func walkPointer(v interface{}, segs []string) (interface{}, bool) {
+	for _, s := range segs {
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			nv, ok := vv[s]
+			if !ok {
+				return nil, false
+			}
+			v = nv
+		case []interface{}:
+			i, err := strconv.Atoi(s)
+			if err != nil || i < 0 || i >= len(vv) {
+				return nil, false
+			}
+			v = vv[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Bundle loads every file named by an include directive and inlines
+// the components that this spec's $refs point into, rewriting those
+// $refs to point at the inlined copy under this document's own
+// components. It leaves the spec unchanged if there are no includes.
+func (spec *openAPISpec) Bundle() error {
+	if len(spec.includes) == 0 {
+		return nil
+	}
+	dir := filepath.Dir(spec.srcFilename)
+	included := make(map[string]*openAPISpec, len(spec.includes))
+	for _, inc := range spec.includes {
+		data, err := os.ReadFile(filepath.Join(dir, inc))
+		if err != nil {
+			return errgo.Notef(err, "include %q", inc)
+		}
+		sub := &openAPISpec{}
+		if err := sub.parse(inc, data); err != nil {
+			return errgo.Notef(err, "include %q", inc)
+		}
+		included[inc] = sub
+	}
+	for _, k := range componentSection {
+		for _, v := range *spec.componentMap(k) {
+			spec.inlineRefs(v, included)
+		}
+	}
+	for _, methods := range spec.Paths {
+		for _, op := range methods {
+			spec.inlineRefs(op, included)
+		}
+	}
+	for _, methods := range spec.Webhooks {
+		for _, op := range methods {
+			spec.inlineRefs(op, included)
+		}
+	}
+	return nil
+}
+
+// inlineRefs walks v looking for external $refs into one of the
+// included specs, copying the referenced component into spec's own
+// components and rewriting the $ref to point at the local copy.
+func (spec *openAPISpec) inlineRefs(v interface{}, included map[string]*openAPISpec) {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := vv["$ref"].(string); ok {
+			if local, ok := spec.inlineExternalRef(ref, included); ok {
+				vv["$ref"] = local
+			}
+		}
+		for _, sub := range vv {
+			spec.inlineRefs(sub, included)
+		}
+	case []interface{}:
+		for _, sub := range vv {
+			spec.inlineRefs(sub, included)
+		}
+	}
+}
+
+// inlineExternalRef resolves an external ref of the form
+// "<include-path>#/components/<section>/<name>" against the matching
+// included spec, copies the named component into spec's own
+// components under a name qualified by its include path, and returns
+// the equivalent local ref. Qualifying by include path avoids
+// silently colliding with (and resolving to) an unrelated local or
+// other-include component of the same name.
+func (spec *openAPISpec) inlineExternalRef(ref string, included map[string]*openAPISpec) (string, bool) {
+	file, frag, ok := strings.Cut(ref, "#")
+	if !ok || file == "" {
+		return "", false
+	}
+	sub, ok := included[file]
+	if !ok {
+		return "", false
+	}
+	segs := pointerSegments("#" + frag)
+	if len(segs) != 3 || segs[0] != "components" {
+		return "", false
+	}
+	k, ok := componentSection[segs[1]]
+	if !ok {
+		return "", false
+	}
+	name := segs[2]
+	srcMap := sub.componentMap(k)
+	v, ok := (*srcMap)[name]
+	if !ok {
+		return "", false
+	}
+	localName := bundledComponentName(file, name)
+	dstMap := spec.componentMap(k)
+	if *dstMap == nil {
+		*dstMap = make(map[string]interface{})
+	}
+	(*dstMap)[localName] = v
+	return "#/components/" + segs[1] + "/" + localName, true
+}
+
+// bundledComponentName derives the name a component named name in an
+// included file is inlined under, qualifying it by the include path
+// so that same-named components from different files (or from the
+// main document) never collide.
+func bundledComponentName(includePath, name string) string {
+	stem := strings.TrimSuffix(filepath.Base(includePath), filepath.Ext(includePath))
+	return stem + "_" + name
+}
+
 var allowedMethods = map[string]bool{
 	"get":    true,
 	"post":   true,
@@ -132,20 +679,81 @@ const (
 	kindSecurity
 	kindPath
 	kindInfo
+	kindParameter
+	kindRequestBody
+	kindResponse
+	kindHeader
+	kindExample
+	kindLink
+	kindCallback
+	kindServer
+	kindTag
+	kindExternalDocs
+	kindOpenAPI
+	kindOperationSecurity
+	kindOperationParam
+	kindOperationTag
+	kindInclude
+	kindWebhook
 )
 
 var kinds = map[string]kind{
-	"info":     kindInfo,
-	"schema":   kindSchema,
-	"security": kindSecurity,
-	"path":     kindPath,
+	"info":         kindInfo,
+	"schema":       kindSchema,
+	"security":     kindSecurity,
+	"path":         kindPath,
+	"parameter":    kindParameter,
+	"requestBody":  kindRequestBody,
+	"response":     kindResponse,
+	"header":       kindHeader,
+	"example":      kindExample,
+	"link":         kindLink,
+	"callback":     kindCallback,
+	"server":       kindServer,
+	"tag":          kindTag,
+	"externalDocs": kindExternalDocs,
+	"openapi":      kindOpenAPI,
+
+	"operation-security": kindOperationSecurity,
+	"operation-param":    kindOperationParam,
+	"operation-tag":      kindOperationTag,
+
+	"include": kindInclude,
+	"webhook": kindWebhook,
 }
 
 var argCount = map[kind]int{
-	kindSchema:   1,
-	kindSecurity: 1,
-	kindPath:     2,
-	kindInfo:     0,
+	kindSchema:       1,
+	kindSecurity:     1,
+	kindPath:         2,
+	kindInfo:         0,
+	kindParameter:    1,
+	kindRequestBody:  1,
+	kindResponse:     1,
+	kindHeader:       1,
+	kindExample:      1,
+	kindLink:         1,
+	kindCallback:     1,
+	kindServer:       1,
+	kindTag:          1,
+	kindExternalDocs: 0,
+	kindOpenAPI:      1,
+
+	kindOperationSecurity: 3,
+	kindOperationParam:    2,
+	kindOperationTag:      3,
+
+	kindInclude: 1,
+	kindWebhook: 2,
+}
+
+// noObjectKinds lists directives that never take a trailing rjson
+// object, so parse doesn't force authors to write a throwaway {} for
+// them: include just names a path, and operation-tag's payload (a
+// single string) is already its last arg.
+var noObjectKinds = map[kind]bool{
+	kindInclude:      true,
+	kindOperationTag: true,
 }
 
 type token int
@@ -207,35 +815,41 @@ func (r *reader) readToken() (token, error) {
 
 func (r *reader) readObject() (token, error) {
 	startOffset := r.offset()
-	// Read all the text up until the next brace at the
-	// start of a line. This is a hack but will have to do
-	// until rjson gets proper decoder support.
-	var buf bytes.Buffer
-	var prevc rune
-	for {
-		c, _, err := r.r.ReadRune()
-		if err != nil {
-			if err == io.EOF {
-				err = io.ErrUnexpectedEOF
-			}
-			return 0, errgo.Mask(err)
+	// Decode directly off r.r. rjson.Decoder has no Buffered or
+	// InputOffset method, so there's no way to hand back bytes it
+	// read past the end of the object it decoded; feed it through
+	// oneByteReader so it never reads further than the scanner
+	// actually needs, and r.r ends up positioned exactly after the
+	// closing brace, ready for the next readToken.
+	dec := rjson.NewDecoder(oneByteReader{r.r})
+	var m interface{}
+	if err := dec.Decode(&m); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
 		}
-		buf.WriteRune(c)
-		if c == '}' && prevc == '\n' {
-			break
+		offset := startOffset
+		if serr, ok := err.(*rjson.SyntaxError); ok {
+			offset += int(serr.Offset)
 		}
-		prevc = c
+		return 0, errgo.Newf("%s: %v", r.offsetToPos(offset), err)
 	}
-	var m interface{}
-	err := rjson.Unmarshal(buf.Bytes(), &m)
-	if err == nil {
-		r.obj = m
-		return tokenObject, nil
-	}
-	if err, ok := err.(*rjson.SyntaxError); ok {
-		return 0, errgo.Newf("%s: %v", r.offsetToPos(startOffset+int(err.Offset)), err)
+	r.obj = m
+	return tokenObject, nil
+}
+
+// oneByteReader wraps an io.Reader, reading at most one byte per
+// call regardless of the size of the buffer passed to Read. This
+// stops rjson.Decoder's internal buffering from consuming bytes that
+// belong to whatever follows the object being decoded.
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (o oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
 	}
-	return 0, errgo.Mask(err)
+	return o.r.Read(p[:1])
 }
 
 func (r *reader) readSpace() error {
@@ -256,18 +870,26 @@ func (r *reader) offset() int {
 }
 
 func (r *reader) offsetToPos(off int) string {
+	return formatPos(r.filename, r.buf, off)
+}
+
+// formatPos renders off, a byte offset into buf, as a "file:line:col"
+// position. It's shared between reader (while parsing) and
+// openAPISpec (after parsing, once the reader is gone) so error
+// locations look the same either way.
+func formatPos(filename string, buf []byte, off int) string {
 	line := 1
 	start := 0
-	for i, b := range r.buf {
+	for i, b := range buf {
 		if b != '\n' {
 			continue
 		}
 		if i >= off {
 			lineOff := off - start
-			return fmt.Sprintf("%s:%d:%d", r.filename, line, lineOff)
+			return fmt.Sprintf("%s:%d:%d", filename, line, lineOff)
 		}
 		line++
 		start = i
 	}
-	return fmt.Sprintf("%s:%d", r.filename, line)
+	return fmt.Sprintf("%s:%d", filename, line)
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, filename, src string) *openAPISpec {
+	t.Helper()
+	spec := &openAPISpec{}
+	if err := spec.parse(filename, []byte(src)); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return spec
+}
+
+func TestValidateUnresolvedRef(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		schema Pet {"type": "object", "properties": {"owner": {"$ref": "#/components/schemas/Missing"}}}
+	`)
+	err := spec.Validate()
+	if err == nil {
+		t.Fatal("expected an error for an unresolved $ref")
+	}
+	if !strings.Contains(err.Error(), `unresolved $ref "#/components/schemas/Missing"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateResolvedRef(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		schema Owner {"type": "string"}
+		schema Pet {"type": "object", "properties": {"owner": {"$ref": "#/components/schemas/Owner"}}}
+	`)
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestValidateDanglingSecurityScheme(t *testing.T) {
+	spec := mustParse(t, "spec.rjson", `
+		path /pets get {"responses": {}}
+		operation-security /pets get apiKey {}
+	`)
+	err := spec.Validate()
+	if err == nil {
+		t.Fatal("expected an error for an undeclared security scheme")
+	}
+	if !strings.Contains(err.Error(), `security scheme "apiKey" not declared`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateUnknownMethod(t *testing.T) {
+	spec := &openAPISpec{
+		Paths: map[string]map[string]interface{}{
+			"/pets": {"patch": map[string]interface{}{}},
+		},
+	}
+	err := spec.Validate()
+	if err == nil {
+		t.Fatal("expected an error for an unknown HTTP method")
+	}
+	if !strings.Contains(err.Error(), `unknown method "patch"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBundleInlinesExternalRef(t *testing.T) {
+	dir := t.TempDir()
+	included := `schema Widget {"type": "object", "properties": {"name": {"type": "string"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "shared.rjson"), []byte(included), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	spec := &openAPISpec{}
+	src := `
+		include shared.rjson
+		schema Gadget {"type": "object", "properties": {"widget": {"$ref": "shared.rjson#/components/schemas/Widget"}}}
+	`
+	if err := spec.parse(filepath.Join(dir, "main.rjson"), []byte(src)); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := spec.Bundle(); err != nil {
+		t.Fatalf("Bundle: %v", err)
+	}
+	const wantName = "shared_Widget"
+	if _, ok := spec.Components.Schemas[wantName]; !ok {
+		t.Fatalf("expected inlined schema %q, got %v", wantName, spec.Components.Schemas)
+	}
+	gadget := spec.Components.Schemas["Gadget"].(map[string]interface{})
+	props := gadget["properties"].(map[string]interface{})
+	widgetRef := props["widget"].(map[string]interface{})["$ref"]
+	if widgetRef != "#/components/schemas/"+wantName {
+		t.Fatalf("ref not rewritten to local copy: %v", widgetRef)
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("Validate after Bundle: %v", err)
+	}
+}
+
+func TestBundleDoesNotCollideWithLocalComponent(t *testing.T) {
+	dir := t.TempDir()
+	included := `schema Error {"type": "object", "properties": {"message": {"type": "string"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "included.rjson"), []byte(included), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	spec := &openAPISpec{}
+	src := `
+		include included.rjson
+		schema Error {"type": "object", "properties": {"unrelatedLocalField": {"type": "string"}}}
+		schema Envelope {"type": "object", "properties": {"error": {"$ref": "included.rjson#/components/schemas/Error"}}}
+	`
+	if err := spec.parse(filepath.Join(dir, "main.rjson"), []byte(src)); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := spec.Bundle(); err != nil {
+		t.Fatalf("Bundle: %v", err)
+	}
+	envelope := spec.Components.Schemas["Envelope"].(map[string]interface{})
+	props := envelope["properties"].(map[string]interface{})
+	ref := props["error"].(map[string]interface{})["$ref"].(string)
+	if ref == "#/components/schemas/Error" {
+		t.Fatal("inlined ref must not resolve to the unrelated local Error schema")
+	}
+	segs := pointerSegments(ref)
+	target, ok := (*spec.componentMap(componentSection[segs[1]]))[segs[2]]
+	if !ok {
+		t.Fatalf("rewritten ref %q does not resolve", ref)
+	}
+	targetProps := target.(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := targetProps["message"]; !ok {
+		t.Fatalf("rewritten ref resolved to the wrong schema: %v", target)
+	}
+}